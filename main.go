@@ -2,7 +2,14 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -61,12 +68,559 @@ func (c *ChannelCounter) GetValue() int {
 	return <-c.getValue // request and receive value
 }
 
+// APPROACH 3: Using a hand-rolled TryLock/timeout mutex (optimistic Shared Memory)
+
+// TMutex is a minimal mutex built on an atomic state flag plus a buffered
+// channel used only to wake a blocked waiter. Unlike sync.Mutex it exposes
+// TryLock and LockWithTimeout so callers can choose not to block forever.
+type TMutex struct {
+	state int32         // 0 = unlocked, 1 = locked
+	wake  chan struct{} // size-1 semaphore, signals "state may have changed"
+}
+
+func NewTMutex() *TMutex {
+	return &TMutex{wake: make(chan struct{}, 1)}
+}
+
+// TryLock attempts the fast path CAS and returns immediately either way.
+func (m *TMutex) TryLock() bool {
+	return atomic.CompareAndSwapInt32(&m.state, 0, 1)
+}
+
+func (m *TMutex) Lock() {
+	for !m.TryLock() {
+		<-m.wake // sleep until an Unlock wakes us, then retry the CAS
+	}
+}
+
+func (m *TMutex) Unlock() {
+	atomic.StoreInt32(&m.state, 0)
+	select {
+	case m.wake <- struct{}{}: // wake at most one waiter
+	default: // nobody waiting, or one is already queued
+	}
+}
+
+// LockWithTimeout races the wake signal against a deadline and reports
+// whether the lock was acquired before it expired.
+func (m *TMutex) LockWithTimeout(d time.Duration) bool {
+	deadline := time.After(d)
+	for {
+		if m.TryLock() {
+			return true
+		}
+		select {
+		case <-m.wake:
+			// woken up, loop around and retry the CAS
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+type TryMutexCounter struct {
+	mu    *TMutex
+	value int
+}
+
+func NewTryMutexCounter() *TryMutexCounter {
+	return &TryMutexCounter{mu: NewTMutex()}
+}
+
+func (c *TryMutexCounter) Increment() {
+	c.mu.Lock()
+	c.value++
+	c.mu.Unlock()
+}
+
+func (c *TryMutexCounter) GetValue() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// benchmarkTryLockContention hammers a single TMutex with TryLock calls from
+// many goroutines and reports how often the optimistic fast path fails,
+// which is the thing a blocking Lock() hides from you.
+func benchmarkTryLockContention(numGoroutines int, attemptsPerGoroutine int) {
+	mu := NewTMutex()
+	var wg sync.WaitGroup
+	var failures int64
+
+	start := time.Now()
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < attemptsPerGoroutine; j++ {
+				if mu.TryLock() {
+					mu.Unlock()
+				} else {
+					atomic.AddInt64(&failures, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	totalAttempts := numGoroutines * attemptsPerGoroutine
+	fmt.Printf("\nTRYLOCK Results:\n")
+	fmt.Printf(" Time taken: %v\n", duration)
+	fmt.Printf(" Total attempts: %d\n", totalAttempts)
+	fmt.Printf(" Failed attempts: %d (%.1f%%)\n", failures, 100*float64(failures)/float64(totalAttempts))
+}
+
+// APPROACH 4: A single int64 bumped with atomic.AddInt64, no locking at all.
+type AtomicCounter struct {
+	value int64
+}
+
+func (c *AtomicCounter) Increment() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+func (c *AtomicCounter) GetValue() int {
+	return int(atomic.LoadInt64(&c.value))
+}
+
+// APPROACH 5: N cache-line-padded atomic shards, one per CPU, so goroutines
+// running on different cores don't bounce the same cache line back and
+// forth. GetValue sums every shard, so it's cheap to write and a bit more
+// expensive to read - the usual tradeoff for a hot counter.
+type paddedCounter struct {
+	value int64
+	_     [56]byte // pad the 8-byte value out to a full 64-byte cache line
+}
+
+type ShardedCounter struct {
+	shards []paddedCounter
+}
+
+func NewShardedCounter() *ShardedCounter {
+	return &ShardedCounter{shards: make([]paddedCounter, runtime.NumCPU())}
+}
+
+// shardRandPool hands each goroutine its own *rand.Rand so picking a shard
+// doesn't itself require a shared lock.
+var shardRandPool = sync.Pool{
+	New: func() interface{} {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	},
+}
+
+func (c *ShardedCounter) Increment() {
+	r := shardRandPool.Get().(*rand.Rand)
+	shard := r.Intn(len(c.shards))
+	shardRandPool.Put(r)
+	atomic.AddInt64(&c.shards[shard].value, 1)
+}
+
+func (c *ShardedCounter) GetValue() int {
+	var total int64
+	for i := range c.shards {
+		total += atomic.LoadInt64(&c.shards[i].value)
+	}
+	return int(total)
+}
+
+// APPROACH 6: a batching channel counter. The plain ChannelCounter pays a
+// channel send for every single Increment; this version lets each caller
+// accumulate locally and only ships a delta once it has built up enough of
+// them, closing most of the gap with the mutex version.
+const batchFlushThreshold = 128
+
+// batchMsg is sent on the owner's channel: a plain delta to add, or (when
+// reply is set) a request for the current total.
+type batchMsg struct {
+	delta int
+	reply chan int
+}
+
+// batchAccumulator is a goroutine-local buffer handed out by sync.Pool. It
+// only talks to the owner once it crosses batchFlushThreshold or is force
+// drained by Flush.
+type batchAccumulator struct {
+	mu      sync.Mutex
+	count   int
+	counter *BatchedChannelCounter
+}
+
+func (a *batchAccumulator) add(delta int) {
+	a.mu.Lock()
+	a.count += delta
+	if a.count >= batchFlushThreshold {
+		a.flushLocked()
+	}
+	a.mu.Unlock()
+}
+
+func (a *batchAccumulator) flushLocked() {
+	if a.count == 0 {
+		return
+	}
+	a.counter.msgs <- batchMsg{delta: a.count}
+	a.count = 0
+}
+
+func (a *batchAccumulator) flush() {
+	a.mu.Lock()
+	a.flushLocked()
+	a.mu.Unlock()
+}
+
+type BatchedChannelCounter struct {
+	msgs chan batchMsg
+	pool sync.Pool
+
+	regMu        sync.Mutex
+	accumulators []*batchAccumulator // every accumulator Flush must drain
+}
+
+func NewBatchedChannelCounter() *BatchedChannelCounter {
+	c := &BatchedChannelCounter{msgs: make(chan batchMsg, 1024)}
+	c.pool.New = func() interface{} {
+		acc := &batchAccumulator{counter: c}
+		c.regMu.Lock()
+		c.accumulators = append(c.accumulators, acc)
+		c.regMu.Unlock()
+		return acc
+	}
+
+	// This goroutine OWNS the running total - no locks needed, only it
+	// touches total. Queries and deltas share one channel so a query is
+	// always answered after every delta sent ahead of it.
+	go func() {
+		total := 0
+		for msg := range c.msgs {
+			if msg.reply != nil {
+				msg.reply <- total
+			} else {
+				total += msg.delta
+			}
+		}
+	}()
+	return c
+}
+
+func (c *BatchedChannelCounter) Increment() {
+	acc := c.pool.Get().(*batchAccumulator)
+	acc.add(1)
+	c.pool.Put(acc)
+}
+
+// Flush force-drains every pooled accumulator into the owner's total, so a
+// subsequent GetValue doesn't miss deltas still sitting in a goroutine's
+// local buffer.
+func (c *BatchedChannelCounter) Flush() {
+	c.regMu.Lock()
+	accs := make([]*batchAccumulator, len(c.accumulators))
+	copy(accs, c.accumulators)
+	c.regMu.Unlock()
+
+	for _, acc := range accs {
+		acc.flush()
+	}
+}
+
+func (c *BatchedChannelCounter) GetValue() int {
+	c.Flush()
+	reply := make(chan int)
+	c.msgs <- batchMsg{reply: reply}
+	return <-reply
+}
+
+// BUCKETED COUNTERS: counting work by category, not just a single total.
+
+// BucketedCounter tracks independent counts keyed by an arbitrary bucket
+// name, e.g. counting requests per endpoint or jobs per status.
+type BucketedCounter interface {
+	Increment(bucket string)
+	Add(bucket string, delta int)
+	Get(bucket string) int
+	Snapshot() map[string]int
+}
+
+// APPROACH 1 (bucketed): a single map guarded by one mutex.
+type MutexBucketedCounter struct {
+	mu     sync.Mutex
+	values map[string]int
+}
+
+func NewMutexBucketedCounter() *MutexBucketedCounter {
+	return &MutexBucketedCounter{values: make(map[string]int)}
+}
+
+func (c *MutexBucketedCounter) Increment(bucket string) { c.Add(bucket, 1) }
+
+func (c *MutexBucketedCounter) Add(bucket string, delta int) {
+	c.mu.Lock()
+	c.values[bucket] += delta
+	c.mu.Unlock()
+}
+
+func (c *MutexBucketedCounter) Get(bucket string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[bucket]
+}
+
+func (c *MutexBucketedCounter) Snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(c.values))
+	for k, v := range c.values {
+		out[k] = v
+	}
+	return out
+}
+
+// APPROACH 2 (bucketed): bucket keys are hashed into N independent shards so
+// unrelated buckets don't contend on the same mutex, and existing keys are
+// bumped with an atomic add instead of holding the shard lock.
+type atomicBucketShard struct {
+	mu sync.RWMutex
+	m  map[string]*int64
+}
+
+type ShardedAtomicBucketedCounter struct {
+	shards []*atomicBucketShard
+}
+
+func NewShardedAtomicBucketedCounter(numShards int) *ShardedAtomicBucketedCounter {
+	shards := make([]*atomicBucketShard, numShards)
+	for i := range shards {
+		shards[i] = &atomicBucketShard{m: make(map[string]*int64)}
+	}
+	return &ShardedAtomicBucketedCounter{shards: shards}
+}
+
+func hashBucket(bucket string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	return h.Sum32()
+}
+
+func (c *ShardedAtomicBucketedCounter) shardFor(bucket string) *atomicBucketShard {
+	return c.shards[hashBucket(bucket)%uint32(len(c.shards))]
+}
+
+// slotFor returns the *int64 for bucket. The common case - the bucket
+// already exists - only takes the shard's read lock, so repeated
+// increments to an established bucket never block each other; the write
+// lock is only taken the first time a bucket is seen, and re-checked after
+// acquiring it in case another goroutine created it in the meantime.
+func (c *ShardedAtomicBucketedCounter) slotFor(bucket string) *int64 {
+	shard := c.shardFor(bucket)
+
+	shard.mu.RLock()
+	slot, ok := shard.m[bucket]
+	shard.mu.RUnlock()
+	if ok {
+		return slot
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if slot, ok := shard.m[bucket]; ok {
+		return slot
+	}
+	slot = new(int64)
+	shard.m[bucket] = slot
+	return slot
+}
+
+func (c *ShardedAtomicBucketedCounter) Increment(bucket string) { c.Add(bucket, 1) }
+
+func (c *ShardedAtomicBucketedCounter) Add(bucket string, delta int) {
+	atomic.AddInt64(c.slotFor(bucket), int64(delta))
+}
+
+func (c *ShardedAtomicBucketedCounter) Get(bucket string) int {
+	return int(atomic.LoadInt64(c.slotFor(bucket)))
+}
+
+func (c *ShardedAtomicBucketedCounter) Snapshot() map[string]int {
+	out := make(map[string]int)
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		for k, v := range shard.m {
+			out[k] = int(atomic.LoadInt64(v))
+		}
+		shard.mu.RUnlock()
+	}
+	return out
+}
+
+// APPROACH 3 (bucketed): a single owner goroutine holds the map; callers
+// never touch it directly, they just send requests down channels.
+type bucketIncrement struct {
+	bucket string
+	delta  int
+}
+
+type bucketQuery struct {
+	bucket string
+	reply  chan int
+}
+
+type ChannelBucketedCounter struct {
+	increments chan bucketIncrement
+	queries    chan bucketQuery
+	snapshots  chan chan map[string]int
+}
+
+func NewChannelBucketedCounter() *ChannelBucketedCounter {
+	c := &ChannelBucketedCounter{
+		increments: make(chan bucketIncrement),
+		queries:    make(chan bucketQuery),
+		snapshots:  make(chan chan map[string]int),
+	}
+
+	// This goroutine OWNS the map - no locks needed, only it touches values.
+	go func() {
+		values := make(map[string]int)
+		for {
+			select {
+			case inc := <-c.increments:
+				values[inc.bucket] += inc.delta
+			case q := <-c.queries:
+				q.reply <- values[q.bucket]
+			case reply := <-c.snapshots:
+				snap := make(map[string]int, len(values))
+				for k, v := range values {
+					snap[k] = v
+				}
+				reply <- snap
+			}
+		}
+	}()
+	return c
+}
+
+func (c *ChannelBucketedCounter) Increment(bucket string) { c.Add(bucket, 1) }
+
+func (c *ChannelBucketedCounter) Add(bucket string, delta int) {
+	c.increments <- bucketIncrement{bucket: bucket, delta: delta}
+}
+
+func (c *ChannelBucketedCounter) Get(bucket string) int {
+	reply := make(chan int)
+	c.queries <- bucketQuery{bucket: bucket, reply: reply}
+	return <-reply
+}
+
+func (c *ChannelBucketedCounter) Snapshot() map[string]int {
+	reply := make(chan map[string]int)
+	c.snapshots <- reply
+	return <-reply
+}
+
+// benchmarkBucketed mirrors benchmarkCounter but has each goroutine hammer
+// one of numBuckets bucket names (picked round-robin), so it shows how the
+// three approaches scale with both goroutine count and bucket count.
+func benchmarkBucketed(name string, counter BucketedCounter, numGoroutines int, incrementsPerGoroutine int, numBuckets int) {
+	buckets := make([]string, numBuckets)
+	for i := range buckets {
+		buckets[i] = fmt.Sprintf("bucket-%d", i)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		bucket := buckets[i%numBuckets]
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrementsPerGoroutine; j++ {
+				counter.Increment(bucket)
+			}
+		}()
+	}
+
+	wg.Wait()
+	duration := time.Since(start)
+
+	snapshot := counter.Snapshot()
+	total := 0
+	for _, v := range snapshot {
+		total += v
+	}
+	expected := numGoroutines * incrementsPerGoroutine
+
+	fmt.Printf("\n%s Results:\n", name)
+	fmt.Printf(" Time taken: %v\n", duration)
+	fmt.Printf(" Buckets: %d\n", numBuckets)
+	fmt.Printf(" Total value: %d (expected: %d)\n", total, expected)
+	fmt.Printf(" Correct: %v\n", total == expected)
+	fmt.Printf(" Operations/second: %.0f\n", float64(expected)/duration.Seconds())
+}
+
+// CONTENTION ACCOUNTING: times how long each call took to get in and out,
+// which for a lock is mostly wait time and for the channel counter is the
+// time the send/receive took to complete. Each goroutine records into its
+// own local slice (no shared lock on the hot path) and the slices are
+// merged into one contentionStats after all goroutines finish, which is
+// the only place the per-goroutine slices are combined; that merge runs
+// on a single goroutine and takes no lock.
+
+type contentionStats struct {
+	waits []time.Duration
+}
+
+// merge appends another goroutine's locally recorded waits. Only ever
+// called sequentially after wg.Wait(), never from the hot path, so no
+// lock is needed here.
+func (s *contentionStats) merge(local []time.Duration) {
+	s.waits = append(s.waits, local...)
+}
+
+// percentile returns the wait duration at percentile p (0..1). Goroutine-
+// blocked time sums every recorded wait, so 100 goroutines blocked 10ms
+// counts as 1000ms, not 10ms.
+func (s *contentionStats) percentile(p float64) time.Duration {
+	if len(s.waits) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(s.waits))
+	copy(sorted, s.waits)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p * float64(len(sorted)-1))
+	return sorted[idx]
+}
+
+func (s *contentionStats) totalBlocked() time.Duration {
+	var total time.Duration
+	for _, d := range s.waits {
+		total += d
+	}
+	return total
+}
+
+// dumpMutexProfile prints the top contended call sites accumulated since
+// runtime.SetMutexProfileFraction was enabled. The profile is process-wide
+// and cumulative across the whole run, not scoped to whatever happened
+// since the last dump - call it once at the end, not after each benchmark.
+func dumpMutexProfile(label string) {
+	profile := pprof.Lookup("mutex")
+	if profile == nil || profile.Count() == 0 {
+		return
+	}
+	fmt.Printf(" Mutex profile (%s), %d contended call sites across the whole session:\n", label, profile.Count())
+	if err := profile.WriteTo(os.Stdout, 1); err != nil {
+		fmt.Printf(" failed to write mutex profile: %v\n", err)
+	}
+}
+
 // BENCHMARK FUNCTION
 func benchmarkCounter(name string, counter interface {
 	Increment()
 	GetValue() int
 }, numGoroutines int, incrementsPerGoroutine int) {
 
+	localWaits := make([][]time.Duration, numGoroutines)
+
 	start := time.Now()
 	var wg sync.WaitGroup
 
@@ -75,18 +629,31 @@ func benchmarkCounter(name string, counter interface {
 	for i := 0; i < numGoroutines; i++ {
 		wg.Add(1)
 
+		goroutineIndex := i
 		go func() {
 			defer wg.Done()
+			waits := make([]time.Duration, 0, incrementsPerGoroutine)
 			for j := 0; j < incrementsPerGoroutine; j++ {
+				opStart := time.Now()
 				counter.Increment()
+				waits = append(waits, time.Since(opStart))
 			}
+			localWaits[goroutineIndex] = waits
 		}()
 	}
 
 	wg.Wait() // wait for all goroutines to finish
 	duration := time.Since(start)
 
+	stats := &contentionStats{}
+	for _, waits := range localWaits {
+		stats.merge(waits)
+	}
+
+	getStart := time.Now()
 	finalValue := counter.GetValue()
+	stats.merge([]time.Duration{time.Since(getStart)})
+
 	expected := numGoroutines * incrementsPerGoroutine
 
 	fmt.Printf("\n%s Results:\n", name)
@@ -94,12 +661,18 @@ func benchmarkCounter(name string, counter interface {
 	fmt.Printf(" Final value: %d (expected: %d)\n", finalValue, expected)
 	fmt.Printf(" Correct: %v\n", finalValue == expected)
 	fmt.Printf(" Operations/second: %.0f\n", float64(expected)/duration.Seconds())
-
+	fmt.Printf(" Wait p50/p95/p99: %v / %v / %v\n",
+		stats.percentile(0.50), stats.percentile(0.95), stats.percentile(0.99))
+	fmt.Printf(" Total goroutine-blocked time: %v\n", stats.totalBlocked())
 }
 
 func main() {
 	fmt.Println("=== Mutex vs Channels Performance Test ===\n")
 
+	// Record every contended mutex acquisition so dumpMutexProfile has
+	// something to report when it is called once at the end of main.
+	runtime.SetMutexProfileFraction(1)
+
 	numGoroutines := 1000
 	incrementsPerGoroutine := 1000
 	totalOperations := numGoroutines * incrementsPerGoroutine
@@ -117,6 +690,43 @@ func main() {
 	channelCounter := NewChannelCounter()
 	benchmarkCounter("CHANNEL", channelCounter, numGoroutines, incrementsPerGoroutine)
 
+	// Test TryMutex:
+	tryMutexCounter := NewTryMutexCounter()
+	benchmarkCounter("TRYMUTEX", tryMutexCounter, numGoroutines, incrementsPerGoroutine)
+
+	// Test Atomic:
+	atomicCounter := &AtomicCounter{}
+	benchmarkCounter("ATOMIC", atomicCounter, numGoroutines, incrementsPerGoroutine)
+
+	// Test Sharded Atomic:
+	shardedCounter := NewShardedCounter()
+	benchmarkCounter("SHARDED", shardedCounter, numGoroutines, incrementsPerGoroutine)
+
+	// Test Batched Channel (amortizes the per-Increment channel send):
+	batchedChannelCounter := NewBatchedChannelCounter()
+	benchmarkCounter("BATCHED CHANNEL", batchedChannelCounter, numGoroutines, incrementsPerGoroutine)
+
+	// Compare optimistic (TryLock) vs blocking acquisition under contention
+	benchmarkTryLockContention(numGoroutines, incrementsPerGoroutine)
+
+	// Counting work by category, not just a single running total
+	fmt.Println("\n=== Bucketed Counters (count by category) ===")
+	numBuckets := 8
+
+	mutexBucketed := NewMutexBucketedCounter()
+	benchmarkBucketed("MUTEX BUCKETED", mutexBucketed, numGoroutines, incrementsPerGoroutine, numBuckets)
+
+	shardedBucketed := NewShardedAtomicBucketedCounter(runtime.NumCPU())
+	benchmarkBucketed("SHARDED ATOMIC BUCKETED", shardedBucketed, numGoroutines, incrementsPerGoroutine, numBuckets)
+
+	channelBucketed := NewChannelBucketedCounter()
+	benchmarkBucketed("CHANNEL BUCKETED", channelBucketed, numGoroutines, incrementsPerGoroutine, numBuckets)
+
+	// Dumped once for the whole session, since the mutex profile is
+	// process-wide and cumulative, not scoped to a single benchmark run.
+	fmt.Println("\n=== Cumulative Mutex Contention ===")
+	dumpMutexProfile("session")
+
 	// Visual demonstration of contention
 	fmt.Println("\n=== Demonstrating Lock Contention ===")
 	demonstrateLockContention()